@@ -0,0 +1,93 @@
+// Package accel detects which hardware virtualization accelerator is
+// available on the host, so callers can avoid falling back to slow
+// software emulation (TCG) when a better option exists.
+package accel
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Kind identifies a QEMU accelerator.
+type Kind string
+
+const (
+	// KVM is Linux's in-kernel virtualization accelerator.
+	KVM Kind = "kvm"
+	// HVF is macOS's Hypervisor.framework accelerator.
+	HVF Kind = "hvf"
+	// WHPX is the Windows Hypervisor Platform accelerator.
+	WHPX Kind = "whpx"
+	// TCG is QEMU's portable software emulator, used when no hardware
+	// accelerator is available.
+	TCG Kind = "tcg"
+)
+
+// Detect probes the host for the best available accelerator, falling back
+// to TCG if nothing better is usable. KVM and HVF are probed; on Windows,
+// WHPX is returned without checking that it is enabled.
+func Detect() Kind {
+	switch runtime.GOOS {
+	case "linux":
+		if hasKVM() {
+			return KVM
+		}
+	case "darwin":
+		if hasHVF() {
+			return HVF
+		}
+	case "windows":
+		return WHPX
+	}
+
+	return TCG
+}
+
+// hasKVM reports whether /dev/kvm exists and is accessible.
+func hasKVM() bool {
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+
+	if err != nil {
+		return false
+	}
+
+	f.Close()
+
+	return true
+}
+
+// hasHVF reports whether the host CPU supports Hypervisor.framework.
+func hasHVF() bool {
+	out, err := exec.Command("sysctl", "-n", "kern.hv_support").Output()
+
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(out)) == "1"
+}
+
+// QEMUAccel returns the value to pass as -machine accel=... for this
+// accelerator, with tcg listed as a fallback.
+func (k Kind) QEMUAccel() string {
+	if k == TCG {
+		return "tcg"
+	}
+
+	return string(k) + ":tcg"
+}
+
+// CPUModel returns the -cpu value that pairs with this accelerator: "host"
+// passes through the host CPU under KVM and HVF, and "max" exposes the
+// broadest feature set QEMU can emulate under every other accelerator
+// (TCG and WHPX).
+func (k Kind) CPUModel() string {
+	switch k {
+	case KVM, HVF:
+		return "host"
+	default:
+		return "max"
+	}
+}
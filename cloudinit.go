@@ -0,0 +1,288 @@
+package fog
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CloudInit configures a Machine's guest provisioning via cloud-init.
+//
+// By default user-data/meta-data are served over the IMDS HTTP endpoint for
+// ds=nocloud-net. Setting ConfigDrive builds an ISO 9660 seed image instead,
+// for guest images that only support the nocloud ConfigDrive datasource.
+type CloudInit struct {
+	Users      []User
+	WriteFiles []WriteFile
+	RunCmd     []string
+	Packages   []string
+	Hostname   string
+	// ExtraYAML is appended verbatim to the rendered #cloud-config document.
+	ExtraYAML string
+	// ConfigDrive switches delivery from nocloud-net (IMDS over HTTP) to a
+	// nocloud ConfigDrive ISO attached as a second drive.
+	ConfigDrive bool
+	// DisableSSHKeyInjection stops fog from automatically adding the
+	// invoking user's ~/.ssh/id_*.pub keys to every user.
+	DisableSSHKeyInjection bool
+}
+
+// User is a cloud-init guest user to create.
+type User struct {
+	Name    string   `yaml:"name"`
+	SSHKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+	Sudo    string   `yaml:"sudo,omitempty"`
+}
+
+// WriteFile is a cloud-init write_files entry.
+type WriteFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Owner       string `yaml:"owner,omitempty"`
+}
+
+// cloudConfigDoc is the subset of the cloud-config schema fog renders.
+type cloudConfigDoc struct {
+	Users      []User      `yaml:"users,omitempty"`
+	WriteFiles []WriteFile `yaml:"write_files,omitempty"`
+	RunCmd     []string    `yaml:"runcmd,omitempty"`
+	Packages   []string    `yaml:"packages,omitempty"`
+	Hostname   string      `yaml:"hostname,omitempty"`
+}
+
+// renderUserData renders the machine's cloud-init user-data document,
+// auto-injecting the invoking user's SSH keys unless disabled.
+func (m *Machine) renderUserData() ([]byte, error) {
+	ci := m.Conf.CloudInit
+
+	if ci == nil {
+		return []byte("#cloud-config\n"), nil
+	}
+
+	doc := cloudConfigDoc{
+		Users:      make([]User, len(ci.Users)),
+		WriteFiles: ci.WriteFiles,
+		RunCmd:     ci.RunCmd,
+		Packages:   ci.Packages,
+		Hostname:   ci.Hostname,
+	}
+
+	for i, u := range ci.Users {
+		doc.Users[i] = u
+		doc.Users[i].SSHKeys = append([]string{}, u.SSHKeys...)
+	}
+
+	if !ci.DisableSSHKeyInjection {
+		keys, err := localSSHPublicKeys()
+
+		if err == nil && len(keys) > 0 {
+			for i := range doc.Users {
+				doc.Users[i].SSHKeys = append(doc.Users[i].SSHKeys, keys...)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+
+	if err := yaml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, fmt.Errorf("encoding cloud-config: %w", err)
+	}
+
+	if ci.ExtraYAML != "" {
+		buf.WriteString(ci.ExtraYAML)
+
+		if !strings.HasSuffix(ci.ExtraYAML, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderMetaData renders the machine's cloud-init meta-data document.
+func (m *Machine) renderMetaData() ([]byte, error) {
+	hostname := m.Name
+
+	if m.Conf.CloudInit != nil && m.Conf.CloudInit.Hostname != "" {
+		hostname = m.Conf.CloudInit.Hostname
+	}
+
+	meta := struct {
+		InstanceID    string `yaml:"instance-id"`
+		LocalHostname string `yaml:"local-hostname"`
+	}{
+		InstanceID:    m.ID,
+		LocalHostname: hostname,
+	}
+
+	return yaml.Marshal(meta)
+}
+
+// localSSHPublicKeys globs the invoking user's ~/.ssh/id_*.pub keys.
+func localSSHPublicKeys() ([]string, error) {
+	u, err := user.Current()
+
+	if err != nil {
+		return nil, fmt.Errorf("looking up current user: %w", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(u.HomeDir, ".ssh", "id_*.pub"))
+
+	if err != nil {
+		return nil, fmt.Errorf("globbing ssh keys: %w", err)
+	}
+
+	var keys []string
+
+	for _, path := range matches {
+		b, err := os.ReadFile(path)
+
+		if err != nil {
+			continue
+		}
+
+		keys = append(keys, strings.TrimSpace(string(b)))
+	}
+
+	return keys, nil
+}
+
+// IMDSServer serves cloud-init user-data/meta-data for registered machines
+// under ds=nocloud-net, keyed by machine ID: GET /<id>/user-data and
+// GET /<id>/meta-data.
+type IMDSServer struct {
+	mu       sync.RWMutex
+	machines map[string]*Machine
+}
+
+// NewIMDSServer allocates an empty IMDSServer.
+func NewIMDSServer() *IMDSServer {
+	return &IMDSServer{machines: make(map[string]*Machine)}
+}
+
+// Register makes m's cloud-init data available under its machine ID.
+func (s *IMDSServer) Register(m *Machine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.machines[m.ID] = m
+}
+
+// Deregister removes m from the server.
+func (s *IMDSServer) Deregister(m *Machine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.machines, m.ID)
+}
+
+func (s *IMDSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	m, ok := s.machines[parts[0]]
+	s.mu.RUnlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	switch parts[1] {
+	case "user-data":
+		data, err = m.renderUserData()
+	case "meta-data":
+		data, err = m.renderMetaData()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(data)
+}
+
+// buildConfigDrive renders user-data/meta-data and packs them into an ISO
+// 9660 image with volume label "cidata" at outPath, using whichever of
+// genisoimage/mkisofs/xorriso is available on PATH.
+func (m *Machine) buildConfigDrive(outPath string) error {
+	dir, err := os.MkdirTemp("", "fog-configdrive-")
+
+	if err != nil {
+		return fmt.Errorf("creating configdrive staging dir: %w", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	userData, err := m.renderUserData()
+
+	if err != nil {
+		return err
+	}
+
+	metaData, err := m.renderMetaData()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "user-data"), userData, 0o644); err != nil {
+		return fmt.Errorf("writing user-data: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "meta-data"), metaData, 0o644); err != nil {
+		return fmt.Errorf("writing meta-data: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "network-config"), []byte{}, 0o644); err != nil {
+		return fmt.Errorf("writing network-config: %w", err)
+	}
+
+	for _, tool := range []string{"genisoimage", "mkisofs", "xorriso"} {
+		bin, err := exec.LookPath(tool)
+
+		if err != nil {
+			continue
+		}
+
+		args := []string{"-output", outPath, "-volid", "cidata", "-joliet", "-rock", dir}
+
+		if tool == "xorriso" {
+			args = append([]string{"-as", "genisoimage"}, args...)
+		}
+
+		cmd := exec.Command(bin, args...)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("building configdrive iso: %w: %s", err, out)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no ISO 9660 tool (genisoimage/mkisofs/xorriso) found on PATH")
+}
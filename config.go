@@ -0,0 +1,23 @@
+package fog
+
+import "go.destructure.co/fog/qemu"
+
+// MachineConfig describes how a Machine should be booted: its resources,
+// port forwarding, and guest provisioning.
+type MachineConfig struct {
+	// Memory is the amount of RAM to give the machine, in QEMU's -m syntax
+	// (e.g. "2G").
+	Memory string
+	// Ports are QEMU -net user hostfwd rules (e.g. "tcp::2222-:22").
+	Ports []string
+	// CloudInit configures guest provisioning via cloud-init. Nil disables
+	// cloud-init entirely.
+	CloudInit *CloudInit
+	// Profile selects the machine-type profile used to build QEMU's argv.
+	// The zero value falls back to qemu.ProfileServer.
+	Profile qemu.Profile
+	// ExtraDevices are additional -device specs layered onto the profile.
+	ExtraDevices []string
+	// ExtraDrives are additional -drive specs layered onto the profile.
+	ExtraDrives []string
+}
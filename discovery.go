@@ -0,0 +1,294 @@
+package fog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/hashicorp/mdns"
+	"github.com/spf13/cobra"
+)
+
+const (
+	mdnsService = "_fog._tcp"
+	mdnsDomain  = "local."
+	// ipPollInterval governs how often a running machine's re-announce
+	// loop checks whether the host's advertised IPs have changed.
+	ipPollInterval = 15 * time.Second
+	// mdnsPort is the SRV record port advertised for the _fog._tcp
+	// service. It identifies the fog host, not a guest port; guests are
+	// reached via the hostfwd ports carried in the TXT "ports=" field.
+	mdnsPort = 7780
+)
+
+// MachineInfo is what Discover learns about a machine advertising itself on
+// the LAN.
+type MachineInfo struct {
+	Name            string
+	ID              string
+	Addr            string
+	Ports           []string
+	SerialSockPath  string
+	MonitorSockPath string
+}
+
+// startDiscovery registers an mDNS service for the machine, advertising its
+// name, ID, forwarded ports, and serial/monitor socket paths in TXT
+// records, plus an A record for "<name>.fog.local.".
+func (m *Machine) startDiscovery() error {
+	ips := hostIPs()
+
+	svc, err := mdns.NewMDNSService(
+		m.Name,
+		mdnsService,
+		mdnsDomain,
+		m.Name+".fog."+mdnsDomain,
+		mdnsPort,
+		ips,
+		[]string{
+			"id=" + m.ID,
+			"ports=" + strings.Join(m.Conf.Ports, ","),
+			"serial=" + m.addr,
+			"monitor=" + m.monAddr,
+		},
+	)
+
+	if err != nil {
+		return fmt.Errorf("building mdns service: %w", err)
+	}
+
+	srv, err := mdns.NewServer(&mdns.Config{Zone: svc})
+
+	if err != nil {
+		return fmt.Errorf("starting mdns server: %w", err)
+	}
+
+	m.discMu.Lock()
+	m.mdnsServer = srv
+	m.discStop = make(chan struct{})
+	m.discMu.Unlock()
+
+	go m.watchIPChanges(ips)
+
+	return nil
+}
+
+// stopDiscovery deregisters the machine's mDNS service.
+func (m *Machine) stopDiscovery() error {
+	m.discMu.Lock()
+	srv := m.mdnsServer
+	m.mdnsServer = nil
+	stop := m.discStop
+	m.discStop = nil
+	m.discMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+
+	if srv == nil {
+		return nil
+	}
+
+	return srv.Shutdown()
+}
+
+// watchIPChanges periodically checks whether the host's advertised IPs
+// have changed and, if so, re-announces the mDNS service with the new set.
+//
+// A netlink address-change subscription would be more efficient, but isn't
+// available on every platform fog targets, so we poll instead.
+func (m *Machine) watchIPChanges(last []net.IP) {
+	ticker := time.NewTicker(ipPollInterval)
+	defer ticker.Stop()
+
+	m.discMu.Lock()
+	stop := m.discStop
+	m.discMu.Unlock()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := hostIPs()
+
+		if ipsEqual(last, current) {
+			continue
+		}
+
+		log.Debug("Host IPs changed, re-announcing mdns service", "name", m.Name)
+
+		if err := m.stopDiscovery(); err != nil {
+			log.Warn("Failed to stop mdns service for re-announce", "name", m.Name, "err", err)
+			return
+		}
+
+		if err := m.startDiscovery(); err != nil {
+			log.Warn("Failed to re-announce mdns service", "name", m.Name, "err", err)
+		}
+
+		return
+	}
+}
+
+func ipsEqual(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hostIPs returns the host's non-loopback IPv4 addresses.
+func hostIPs() []net.IP {
+	var ips []net.IP
+
+	ifaces, err := net.Interfaces()
+
+	if err != nil {
+		return ips
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			var ip net.IP
+
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			}
+
+			if ip != nil && ip.To4() != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	return ips
+}
+
+// Discover browses the LAN for machines advertising themselves over mDNS.
+func Discover(ctx context.Context) ([]MachineInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make(chan *mdns.ServiceEntry, 16)
+	var (
+		infos []MachineInfo
+		wg    sync.WaitGroup
+	)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for e := range entries {
+			infos = append(infos, machineInfoFromEntry(e))
+		}
+	}()
+
+	err := mdns.Lookup(mdnsService, entries)
+	close(entries)
+	wg.Wait()
+
+	if err != nil {
+		return nil, fmt.Errorf("discovering machines: %w", err)
+	}
+
+	return infos, nil
+}
+
+// machineInfoFromEntry decodes a mDNS service entry's TXT record fields
+// into a MachineInfo.
+func machineInfoFromEntry(e *mdns.ServiceEntry) MachineInfo {
+	info := MachineInfo{
+		Name: strings.TrimSuffix(e.Host, ".fog."+mdnsDomain),
+		Addr: e.AddrV4.String(),
+	}
+
+	for _, field := range e.InfoFields {
+		k, v, ok := strings.Cut(field, "=")
+
+		if !ok {
+			continue
+		}
+
+		switch k {
+		case "id":
+			info.ID = v
+		case "ports":
+			if v != "" {
+				info.Ports = strings.Split(v, ",")
+			}
+		case "serial":
+			info.SerialSockPath = v
+		case "monitor":
+			info.MonitorSockPath = v
+		}
+	}
+
+	return info
+}
+
+// LsCmd is the `fog ls` cobra command. It is exported so the root command
+// (not part of this package) can AddCommand it.
+var LsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List machines",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remote, err := cmd.Flags().GetBool("remote")
+
+		if err != nil {
+			return err
+		}
+
+		if !remote {
+			// TODO: wire this up to a running-machine registry once one
+			// exists; for now only --remote discovery is implemented.
+			return fmt.Errorf("ls: local machine listing is not wired up yet, pass --remote")
+		}
+
+		infos, err := Discover(cmd.Context())
+
+		if err != nil {
+			return err
+		}
+
+		for _, info := range infos {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%s\n", info.Name, info.ID, info.Addr)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	LsCmd.Flags().Bool("remote", false, "discover machines on the LAN via mDNS instead of listing local ones")
+}
@@ -0,0 +1,9 @@
+package fog
+
+// Image is a boot disk image a Machine can be created from.
+type Image struct {
+	// Name identifies the image (e.g. "ubuntu-22.04").
+	Name string
+	// Path is the location of the image file on disk.
+	Path string
+}
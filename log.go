@@ -2,26 +2,103 @@ package fog
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"image/color"
 	"io"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/charmbracelet/lipgloss"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
+// LogFormat selects how LogMux renders lines to its output writer.
+type LogFormat int
+
+const (
+	// LogFormatPretty renders a colored "<stream> | <line>" prefix, suitable
+	// for an interactive terminal.
+	LogFormatPretty LogFormat = iota
+	// LogFormatLogfmt renders each line as time=... stream=... msg=...
+	LogFormatLogfmt
+	// LogFormatJSON renders each line as a {"ts":...,"stream":...,"msg":...} object.
+	LogFormatJSON
+)
+
+// Level is the severity of a single log line, detected from its contents.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+var (
+	levelPrefixRe = regexp.MustCompile(`(?i)^\[(trace|debug|info|warn(?:ing)?|error|fatal)\]`)
+	levelFieldRe  = regexp.MustCompile(`(?i)\blevel="?([a-z]+)"?`)
+)
+
+// detectLevel scans a log line for a leading "[INFO]"-style prefix or a
+// "level=" field, returning the level it found and whether anything was
+// found at all. Lines with no detectable level default to LevelInfo.
+func detectLevel(line string) (Level, bool) {
+	if m := levelPrefixRe.FindStringSubmatch(line); m != nil {
+		return levelFromString(m[1]), true
+	}
+
+	if m := levelFieldRe.FindStringSubmatch(line); m != nil {
+		return levelFromString(m[1]), true
+	}
+
+	return LevelInfo, false
+}
+
+func levelFromString(s string) Level {
+	switch strings.ToLower(s) {
+	case "trace", "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error", "fatal":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
 // LogMux is a log multiplexer.
 // It accepts writes for multiple registered log streams and merges the output.
 //
 // Lines for a given stream are prefixed with the name of the stream and a
-// color. Interleaving of streams is minimized as much as possible.
+// color. Interleaving of streams is minimized as much as possible: a stream
+// only ever flushes complete lines, and every flush holds the mux's lock so
+// lines from different streams never intermix on the wire.
 type LogMux struct {
-	mu      sync.Mutex
-	streams map[string]*LogStream
-	bufMs   time.Duration
-	isDirty bool
-	w       io.Writer
+	mu       sync.Mutex
+	streams  map[string]*LogStream
+	bufMs    time.Duration
+	isDirty  bool
+	w        io.Writer
+	format   LogFormat
+	minLevel Level
 }
 
 // LogStream is an individual log stream of the multiplexer.
@@ -30,8 +107,13 @@ type LogStream struct {
 	name string
 	// the color to use for log entries
 	clr color.Color
-	// the write callback
-	w func(p []byte) (int, error)
+
+	mux  *LogMux
+	once sync.Once
+
+	bufMu sync.Mutex
+	buf   bytes.Buffer
+	timer *time.Timer
 }
 
 // NewLogMux allocates and returns a new LogMux.
@@ -40,42 +122,36 @@ func NewLogMux(w io.Writer) *LogMux {
 		streams: make(map[string]*LogStream),
 		bufMs:   time.Millisecond * 10,
 		w:       w,
+		format:  LogFormatPretty,
 	}
 }
 
+// SetFormat sets the output format used when rendering lines.
+func (m *LogMux) SetFormat(f LogFormat) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.format = f
+}
+
+// SetMinLevel sets the minimum detected level a line must have to be
+// written to the mux's output. Lines with no detectable level are treated
+// as LevelInfo.
+func (m *LogMux) SetMinLevel(lvl Level) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.minLevel = lvl
+}
+
 // Stream adds an additional log stream to the multiplexer.
 //
 // Stream panics if a stream has already been registered with the given name.
 func (m *LogMux) Stream(name string) *LogStream {
-	clr := colorful.FastHappyColor()
-
-	// TODO: move more of this into helper fns
-	// TODO: refresh colors before ever writing
-	var b bytes.Buffer
-	var t *time.Timer
-
-	w := func(p []byte) (int, error) {
-		b.Write(p)
-
-		if t == nil {
-			t = time.AfterFunc(m.bufMs, func() {
-				// TODO: include style info
-				// TODO: only flush full lines when possible
-				// TODO: should we return this return value?
-
-				m.w.Write(b.Bytes())
-				b.Reset()
-				t = nil
-			})
-		}
-
-		return len(p), nil
-	}
-
 	s := &LogStream{
 		name: name,
-		clr:  clr,
-		w:    w,
+		clr:  colorful.FastHappyColor(),
+		mux:  m,
 	}
 
 	m.mu.Lock()
@@ -93,7 +169,7 @@ func (m *LogMux) Stream(name string) *LogStream {
 	return s
 }
 
-// refresh the colors of the streams to re-distribute them across the color space.
+// refreshColors re-distributes stream colors across the color space.
 func (m *LogMux) refreshColors() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -113,7 +189,93 @@ func (m *LogMux) refreshColors() {
 	m.isDirty = false
 }
 
-// Write implements io.Writer for a log stream.
+// emit renders a single completed line from s and writes it to the mux's
+// output, holding the mux lock so concurrent streams can't interleave.
+func (m *LogMux) emit(s *LogStream, line string) {
+	if lvl, _ := detectLevel(line); lvl < m.minLevel {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	switch m.format {
+	case LogFormatLogfmt:
+		fmt.Fprintf(m.w, "time=%s stream=%s msg=%q\n", now.Format(time.RFC3339), s.name, line)
+	case LogFormatJSON:
+		b, err := json.Marshal(struct {
+			TS     string `json:"ts"`
+			Stream string `json:"stream"`
+			Msg    string `json:"msg"`
+		}{now.Format(time.RFC3339), s.name, line})
+
+		if err != nil {
+			return
+		}
+
+		m.w.Write(append(b, '\n'))
+	default:
+		prefix := lipgloss.NewStyle().Foreground(lipgloss.Color(colorToHex(s.clr))).Render(s.name)
+		fmt.Fprintf(m.w, "%s | %s\n", prefix, line)
+	}
+}
+
+// colorToHex renders a color.Color as a "#rrggbb" string for lipgloss.
+func colorToHex(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// Write implements io.Writer for a log stream. Complete lines are flushed
+// immediately; a trailing partial line is held until the next write
+// completes it, or bufMs passes without one arriving.
 func (s *LogStream) Write(p []byte) (int, error) {
-	return s.w(p)
+	s.once.Do(s.mux.refreshColors)
+
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+
+	s.buf.Write(p)
+	s.flushLines(false)
+
+	if s.buf.Len() > 0 && s.timer == nil {
+		s.timer = time.AfterFunc(s.mux.bufMs, func() {
+			s.bufMu.Lock()
+			defer s.bufMu.Unlock()
+
+			s.flushLines(true)
+		})
+	}
+
+	return len(p), nil
+}
+
+// flushLines emits every complete line currently buffered. If force is set,
+// any remaining partial line is flushed too. Must be called with bufMu held.
+func (s *LogStream) flushLines(force bool) {
+	for {
+		line, err := s.buf.ReadString('\n')
+
+		if err != nil {
+			// No newline found; put the partial line back for next time.
+			s.buf.Reset()
+			s.buf.WriteString(line)
+			break
+		}
+
+		s.mux.emit(s, strings.TrimSuffix(line, "\n"))
+	}
+
+	if force && s.buf.Len() > 0 {
+		s.mux.emit(s, s.buf.String())
+		s.buf.Reset()
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,12 +12,24 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/charmbracelet/log"
+	"github.com/hashicorp/mdns"
+
+	"go.destructure.co/fog/accel"
+	"go.destructure.co/fog/qemu"
 )
 
+// bootDriveID is the QMP node id given to the machine's boot drive so QMP
+// commands (e.g. blockdev-snapshot-sync) can address it. QEMU's "-hda"
+// shorthand registers the drive under an auto-generated id that QMP does
+// not recognize, so the boot drive is attached via an explicit "-drive
+// id=..." instead.
+const bootDriveID = "hda0"
+
 // Machine is a virtual machine managed by fog.
 type Machine struct {
 	ID      string
@@ -26,8 +39,19 @@ type Machine struct {
 	ImgPath string
 	addr    string
 	monAddr string
+	qmpAddr string
 	connMu  sync.Mutex
 	conn    net.Conn
+	cmd     *exec.Cmd
+	qmpMu   sync.Mutex
+	qmp     *qmpClient
+	// incoming is a QEMU -incoming URI set by LoadState, consumed and
+	// cleared by the next Start.
+	incoming string
+
+	discMu     sync.Mutex
+	mdnsServer *mdns.Server
+	discStop   chan struct{}
 }
 
 func NewMachine(name string, conf *MachineConfig, img *Image, imgPath string) *Machine {
@@ -76,7 +100,31 @@ func (m *Machine) Start(ctx context.Context, opts *StartOptions) error {
 
 	m.monAddr = monAddr
 
+	qmpAddr, err := xdg.RuntimeFile("fog/" + m.ID + "_qmp.sock")
+
+	if err != nil {
+		return fmt.Errorf("generating qmp socket file path: %w", err)
+	}
+
+	m.qmpAddr = qmpAddr
+
 	dsUrl := fmt.Sprintf("http://10.0.2.2:%d/%s/", opts.imdsPort, m.ID)
+	smbios := "type=1,serial=ds=nocloud-net;s=" + dsUrl
+	var configDrivePath string
+
+	if m.Conf.CloudInit != nil && m.Conf.CloudInit.ConfigDrive {
+		configDrivePath, err = xdg.DataFile("fog/" + m.ID + "_cidata.iso")
+
+		if err != nil {
+			return fmt.Errorf("generating configdrive path: %w", err)
+		}
+
+		if err := m.buildConfigDrive(configDrivePath); err != nil {
+			return fmt.Errorf("building configdrive: %w", err)
+		}
+
+		smbios = "type=1,serial=ds=nocloud"
+	}
 
 	fwds := ""
 
@@ -84,51 +132,96 @@ func (m *Machine) Start(ctx context.Context, opts *StartOptions) error {
 		fwds = fmt.Sprintf(",hostfwd=%s", strings.Join(m.Conf.Ports, ","))
 	}
 
-	args := []string{
-		// Machine settings
-		"-machine",
-		// TODO: only enable KVM when supported
-		"accel=kvm:tcg",
+	profile := m.Conf.Profile
+
+	if profile.Name == "" {
+		profile = qemu.ProfileServer
+	}
+
+	builder := qemu.NewArgsBuilder(profile, accel.Detect())
+
+	for _, d := range m.Conf.ExtraDrives {
+		builder.WithDrive(d)
+	}
+
+	for _, d := range m.Conf.ExtraDevices {
+		builder.WithDevice(d)
+	}
+
+	if configDrivePath != "" {
+		builder.WithDrive("file=" + configDrivePath + ",if=virtio,format=raw,readonly=on")
+	}
+
+	args := builder.Build()
+
+	// Disks, NICs, and serial ports attach differently depending on the
+	// bus the profile's machine type exposes: classic PCI/IDE machines use
+	// the legacy IDE -drive/-net nic/-serial flags, while microvm has no legacy
+	// bus and needs everything wired up as explicit virtio-mmio devices.
+	var driveArgs, netArgs, serialArgs []string
+
+	switch profile.Bus {
+	case qemu.BusVirtioMMIO:
+		driveArgs = []string{
+			"-drive", fmt.Sprintf("if=none,id=%s,file=%s", bootDriveID, m.ImgPath),
+			"-device", fmt.Sprintf("virtio-blk-device,drive=%s", bootDriveID),
+		}
+		netArgs = []string{"-netdev", "user,id=net0" + fwds, "-device", "virtio-net-device,netdev=net0"}
+		serialArgs = []string{
+			"-device", "virtconsole,chardev=serial,bus=virtio-serial0.0",
+			"-device", "virtconsole,chardev=tty,bus=virtio-serial0.0",
+		}
+	default:
+		driveArgs = []string{"-drive", fmt.Sprintf("file=%s,if=ide,id=%s", m.ImgPath, bootDriveID)}
+		netArgs = []string{"-net", "nic", "-net", "user" + fwds}
+		serialArgs = []string{"-serial", "chardev:serial", "-serial", "chardev:tty"}
+	}
+
+	args = append(args,
 		// System resources
-		"-cpu",
-		"host",
 		"-m",
 		m.Conf.Memory,
-		// Graphics
-		"-nographic",
-		"-vga",
-		"none",
-		// Boot image
-		"-hda",
-		m.ImgPath,
-		"-snapshot",
-		// Networking
-		"-net",
-		"nic",
-		"-net",
-		"user" + fwds,
+	)
+
+	// Boot image. Writes persist to ImgPath directly (no global -snapshot
+	// overlay) so that Machine.Snapshot's blockdev-snapshot-sync overlays
+	// chain onto a stable backing file; take a snapshot before any change
+	// you want to be able to roll back.
+	args = append(args, driveArgs...)
+	args = append(args, netArgs...)
+
+	args = append(args,
 		// Serial socket
 		"-chardev",
-		"socket,id=serial,path=" + addr + ",server,nowait",
-		"-serial",
-		"chardev:serial",
+		"socket,id=serial,path="+addr+",server,nowait",
 		// TTY socket
 		"-chardev",
-		"socket,id=tty,path=" + ttyAddr + ",server,nowait",
-		"-serial",
-		"chardev:tty",
-		// Monitor socket (only used for debugging ATM)
-		// TODO: pipe QEMU errors from the monitor socket to the parent process
+		"socket,id=tty,path="+ttyAddr+",server,nowait",
+	)
+	args = append(args, serialArgs...)
+
+	args = append(args,
+		// Monitor socket (human-readable, only used for debugging ATM)
 		"-chardev",
-		"socket,id=monitor,path=" + monAddr + ",server,nowait",
+		"socket,id=monitor,path="+monAddr+",server,nowait",
 		"-monitor",
 		"chardev:monitor",
+		// QMP socket, used for lifecycle control (Shutdown/Pause/Resume/...)
+		"-chardev",
+		"socket,id=qmp,path="+qmpAddr+",server,nowait",
+		"-qmp",
+		"chardev:qmp",
 		// Cloud init
 		"-smbios",
-		"type=1,serial=ds=nocloud-net;s=" + dsUrl,
+		smbios,
+	)
+
+	if m.incoming != "" {
+		args = append(args, "-incoming", m.incoming)
+		m.incoming = ""
 	}
 
-	log.Debug("Starting machine", "name", m.Name, "sock", addr, "mon", monAddr)
+	log.Debug("Starting machine", "name", m.Name, "sock", addr, "mon", monAddr, "qmp", qmpAddr)
 
 	cmd := exec.Command(bin, args...)
 
@@ -138,9 +231,133 @@ func (m *Machine) Start(ctx context.Context, opts *StartOptions) error {
 		return fmt.Errorf("starting machine: %w", err)
 	}
 
+	m.cmd = cmd
+
+	qmp, err := dialQMP(ctx, qmpAddr)
+
+	if err != nil {
+		log.Warn("QMP negotiation failed, falling back to SIGTERM for lifecycle control", "name", m.Name, "err", err)
+	} else {
+		m.qmpMu.Lock()
+		m.qmp = qmp
+		m.qmpMu.Unlock()
+	}
+
+	if err := m.startDiscovery(); err != nil {
+		log.Warn("Failed to start mdns discovery", "name", m.Name, "err", err)
+	}
+
 	return nil
 }
 
+// Shutdown gracefully powers down the machine by sending an ACPI shutdown
+// request over QMP. If QMP is unavailable it falls back to SIGTERM.
+func (m *Machine) Shutdown(ctx context.Context) error {
+	if err := m.stopDiscovery(); err != nil {
+		log.Warn("Failed to deregister mdns service", "name", m.Name, "err", err)
+	}
+
+	m.qmpMu.Lock()
+	qmp := m.qmp
+	m.qmpMu.Unlock()
+
+	if qmp == nil {
+		return m.signal(syscall.SIGTERM)
+	}
+
+	_, err := qmp.execute(ctx, "system_powerdown", nil)
+
+	return err
+}
+
+// Pause stops execution of the machine's vCPUs via QMP.
+func (m *Machine) Pause(ctx context.Context) error {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = qmp.execute(ctx, "stop", nil)
+
+	return err
+}
+
+// Resume resumes execution of a machine previously paused with Pause.
+func (m *Machine) Resume(ctx context.Context) error {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = qmp.execute(ctx, "cont", nil)
+
+	return err
+}
+
+// Reset performs a hard reset of the machine via QMP.
+func (m *Machine) Reset(ctx context.Context) error {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = qmp.execute(ctx, "system_reset", nil)
+
+	return err
+}
+
+// Status reports QEMU's current run state (e.g. "running", "paused",
+// "shutdown") via the QMP query-status command.
+func (m *Machine) Status(ctx context.Context) (string, error) {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := qmp.execute(ctx, "query-status", nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return "", fmt.Errorf("parsing query-status reply: %w", err)
+	}
+
+	return status.Status, nil
+}
+
+// requireQMP returns the machine's QMP client, or an error if QMP
+// negotiation failed and there is no protocol fallback for the operation.
+func (m *Machine) requireQMP() (*qmpClient, error) {
+	m.qmpMu.Lock()
+	defer m.qmpMu.Unlock()
+
+	if m.qmp == nil {
+		return nil, errors.New("qmp monitor is unavailable for this machine")
+	}
+
+	return m.qmp, nil
+}
+
+// signal delivers a signal directly to the QEMU process, used as a fallback
+// when the QMP monitor could not be negotiated.
+func (m *Machine) signal(sig syscall.Signal) error {
+	if m.cmd == nil || m.cmd.Process == nil {
+		return errors.New("machine is not running")
+	}
+
+	return m.cmd.Process.Signal(sig)
+}
+
 func (m *Machine) openConn() (net.Conn, error) {
 	m.connMu.Lock()
 
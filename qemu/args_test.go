@@ -0,0 +1,89 @@
+package qemu
+
+import (
+	"reflect"
+	"testing"
+
+	"go.destructure.co/fog/accel"
+)
+
+func TestArgsBuilderBuild(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile Profile
+		accel   accel.Kind
+		want    []string
+	}{
+		{
+			name:    "server/kvm",
+			profile: ProfileServer,
+			accel:   accel.KVM,
+			want: []string{
+				"-machine", "q35,accel=kvm:tcg",
+				"-cpu", "host",
+				"-nographic", "-vga", "none",
+			},
+		},
+		{
+			name:    "server/tcg",
+			profile: ProfileServer,
+			accel:   accel.TCG,
+			want: []string{
+				"-machine", "q35,accel=tcg",
+				"-cpu", "max",
+				"-nographic", "-vga", "none",
+			},
+		},
+		{
+			name:    "desktop/hvf",
+			profile: ProfileDesktop,
+			accel:   accel.HVF,
+			want: []string{
+				"-machine", "q35,accel=hvf:tcg",
+				"-cpu", "host",
+				"-vga", "virtio", "-display", "gtk",
+			},
+		},
+		{
+			name:    "microvm/whpx",
+			profile: ProfileMicroVM,
+			accel:   accel.WHPX,
+			want: []string{
+				"-machine", "microvm,pit=off,pic=off,rtc=off,isa-serial=off,accel=whpx:tcg",
+				"-cpu", "max",
+				"-nographic", "-vga", "none", "-device", "virtio-serial-device,id=virtio-serial0",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := NewArgsBuilder(c.profile, c.accel).Build()
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("Build() = %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestArgsBuilderOverrides(t *testing.T) {
+	got := NewArgsBuilder(ProfileServer, accel.KVM).
+		WithDrive("file=extra.qcow2,if=virtio").
+		WithDevice("virtio-rng-pci").
+		WithVirtiofs("share", "/host/share").
+		Build()
+
+	want := []string{
+		"-machine", "q35,accel=kvm:tcg",
+		"-cpu", "host",
+		"-nographic", "-vga", "none",
+		"-drive", "file=extra.qcow2,if=virtio",
+		"-device", "virtio-rng-pci",
+		"-virtfs", "local,path=/host/share,mount_tag=share,security_model=mapped-xattr",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %#v, want %#v", got, want)
+	}
+}
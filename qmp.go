@@ -0,0 +1,201 @@
+package fog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// qmpClient is a client for QEMU's QMP (QEMU Machine Protocol) monitor.
+//
+// Commands are serialized onto the connection one at a time and replies are
+// correlated back to their caller by the "id" field QMP echoes back, so
+// callers may safely issue commands from multiple goroutines.
+type qmpClient struct {
+	conn   net.Conn
+	dec    *json.Decoder
+	nextID uint64
+
+	mu      sync.Mutex // serializes command issuance on the wire
+	pendMu  sync.Mutex
+	pending map[uint64]chan *qmpMessage
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// qmpMessage is a single line of the QMP JSON protocol, which is either a
+// command reply (has "return" or "error") or an out-of-band event (has
+// "event").
+type qmpMessage struct {
+	Return json.RawMessage `json:"return,omitempty"`
+	Error  *qmpError       `json:"error,omitempty"`
+	ID     uint64          `json:"id,omitempty"`
+
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp json.RawMessage `json:"timestamp,omitempty"`
+}
+
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *qmpError) Error() string {
+	return fmt.Sprintf("qmp: %s: %s", e.Class, e.Desc)
+}
+
+// dialQMP connects to a QMP chardev socket, performs the greeting/
+// qmp_capabilities handshake, and starts the background read loop. Events
+// received after the handshake are logged via the fog logger.
+func dialQMP(ctx context.Context, addr string) (*qmpClient, error) {
+	var conn net.Conn
+	var err error
+
+	// Retry in case QEMU has not finished booting yet.
+	for i := 0; i < 3; i++ {
+		conn, err = net.Dial("unix", addr)
+
+		if err == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("dialing qmp socket: %w", err)
+	}
+
+	c := &qmpClient{
+		conn:    conn,
+		dec:     json.NewDecoder(conn),
+		pending: make(map[uint64]chan *qmpMessage),
+		closed:  make(chan struct{}),
+	}
+
+	// Consume the greeting banner QEMU sends on connect.
+	var greeting qmpMessage
+
+	if err := c.dec.Decode(&greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading qmp greeting: %w", err)
+	}
+
+	go c.readLoop()
+
+	if _, err := c.execute(ctx, "qmp_capabilities", nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("negotiating qmp capabilities: %w", err)
+	}
+
+	return c, nil
+}
+
+// readLoop decodes incoming QMP messages, dispatching replies to the
+// goroutine awaiting them and logging events as they arrive.
+func (c *qmpClient) readLoop() {
+	for {
+		var msg qmpMessage
+
+		if err := c.dec.Decode(&msg); err != nil {
+			c.abort()
+			return
+		}
+
+		if msg.Event != "" {
+			log.Warn("QMP event", "event", msg.Event, "data", string(msg.Data))
+			continue
+		}
+
+		c.pendMu.Lock()
+		ch, ok := c.pending[msg.ID]
+
+		if ok {
+			delete(c.pending, msg.ID)
+		}
+
+		c.pendMu.Unlock()
+
+		if ok {
+			ch <- &msg
+		}
+	}
+}
+
+// abort fails every command currently awaiting a reply, used once the
+// connection is lost.
+func (c *qmpClient) abort() {
+	c.pendMu.Lock()
+	defer c.pendMu.Unlock()
+
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+// execute issues a QMP command and blocks until its reply arrives, the
+// context is canceled, or the connection is lost.
+func (c *qmpClient) execute(ctx context.Context, cmd string, args interface{}) (json.RawMessage, error) {
+	id := atomic.AddUint64(&c.nextID, 1)
+	ch := make(chan *qmpMessage, 1)
+
+	c.pendMu.Lock()
+	c.pending[id] = ch
+	c.pendMu.Unlock()
+
+	c.mu.Lock()
+	enc := json.NewEncoder(c.conn)
+	err := enc.Encode(struct {
+		Execute   string      `json:"execute"`
+		Arguments interface{} `json:"arguments,omitempty"`
+		ID        uint64      `json:"id"`
+	}{cmd, args, id})
+	c.mu.Unlock()
+
+	if err != nil {
+		c.pendMu.Lock()
+		delete(c.pending, id)
+		c.pendMu.Unlock()
+
+		return nil, fmt.Errorf("writing qmp command: %w", err)
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("qmp connection closed while waiting for %q", cmd)
+		}
+
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+
+		return msg.Return, nil
+	case <-c.closed:
+		return nil, fmt.Errorf("qmp connection closed while waiting for %q", cmd)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the underlying QMP connection.
+func (c *qmpClient) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+
+	return c.conn.Close()
+}
@@ -0,0 +1,302 @@
+package fog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// migrateSpeedUnlimited is passed to migrate_set_speed so that SaveState
+// transfers are not artificially throttled.
+const migrateSpeedUnlimited = 1 << 30 // bytes/sec
+
+// migrationCapability is one entry of migrate_set_capabilities' argument.
+type migrationCapability struct {
+	Capability string `json:"capability"`
+	State      bool   `json:"state"`
+}
+
+// SnapshotManifest describes a single disk snapshot taken with
+// Machine.Snapshot, stored alongside the qcow2 overlay so fog can list and
+// prune snapshots without booting the machine.
+type SnapshotManifest struct {
+	Name      string         `yaml:"name"`
+	Parent    string         `yaml:"parent"`
+	Timestamp time.Time      `yaml:"timestamp"`
+	Conf      *MachineConfig `yaml:"conf"`
+}
+
+// snapshotDir returns the directory snapshots for the given machine are
+// stored under, creating it if necessary.
+func snapshotDir(machineID string) (string, error) {
+	dir := filepath.Join(xdg.DataHome, "fog", "snapshots", machineID)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// Snapshot takes a live disk snapshot of the machine's primary drive,
+// writing a qcow2 overlay plus a manifest under
+// xdg.DataFile("fog/snapshots/<machineID>/<name>.qcow2").
+func (m *Machine) Snapshot(ctx context.Context, name string) error {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return err
+	}
+
+	dir, err := snapshotDir(m.ID)
+
+	if err != nil {
+		return err
+	}
+
+	overlay := filepath.Join(dir, name+".qcow2")
+
+	_, err = qmp.execute(ctx, "blockdev-snapshot-sync", map[string]interface{}{
+		"device":        bootDriveID,
+		"snapshot-file": overlay,
+		"format":        "qcow2",
+	})
+
+	if err != nil {
+		return fmt.Errorf("taking disk snapshot: %w", err)
+	}
+
+	manifest := SnapshotManifest{
+		Name:      name,
+		Parent:    m.ImgPath,
+		Timestamp: time.Now(),
+		Conf:      m.Conf,
+	}
+
+	f, err := os.Create(filepath.Join(dir, name+".yaml"))
+
+	if err != nil {
+		return fmt.Errorf("creating snapshot manifest: %w", err)
+	}
+
+	defer f.Close()
+
+	return yaml.NewEncoder(f).Encode(manifest)
+}
+
+// RestoreSnapshot points the machine at a previously taken disk snapshot.
+// The overlay becomes the machine's boot disk on the next Start.
+func (m *Machine) RestoreSnapshot(name string) error {
+	dir, err := snapshotDir(m.ID)
+
+	if err != nil {
+		return err
+	}
+
+	overlay := filepath.Join(dir, name+".qcow2")
+
+	if _, err := os.Stat(overlay); err != nil {
+		return fmt.Errorf("snapshot %q not found: %w", name, err)
+	}
+
+	m.ImgPath = overlay
+
+	return nil
+}
+
+// SaveState saves the machine's full running state (memory, device state,
+// etc.) to path using QEMU's exec-based migration, polling query-migrate
+// until migration completes.
+func (m *Machine) SaveState(ctx context.Context, path string) error {
+	qmp, err := m.requireQMP()
+
+	if err != nil {
+		return err
+	}
+
+	caps := []migrationCapability{{Capability: "events", State: true}}
+
+	if _, err := qmp.execute(ctx, "migrate_set_capabilities", map[string]interface{}{"capabilities": caps}); err != nil {
+		return fmt.Errorf("setting migration capabilities: %w", err)
+	}
+
+	if _, err := qmp.execute(ctx, "migrate_set_speed", map[string]interface{}{"value": migrateSpeedUnlimited}); err != nil {
+		return fmt.Errorf("setting migration speed: %w", err)
+	}
+
+	uri := fmt.Sprintf("exec:cat > %s", path)
+
+	if _, err := qmp.execute(ctx, "migrate", map[string]interface{}{"uri": uri}); err != nil {
+		return fmt.Errorf("starting migration: %w", err)
+	}
+
+	return m.awaitMigration(ctx, qmp)
+}
+
+// awaitMigration polls query-migrate until the in-flight migration reaches
+// a terminal state.
+func (m *Machine) awaitMigration(ctx context.Context, qmp *qmpClient) error {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		raw, err := qmp.execute(ctx, "query-migrate", nil)
+
+		if err != nil {
+			return fmt.Errorf("querying migration status: %w", err)
+		}
+
+		var status struct {
+			Status string `json:"status"`
+		}
+
+		if err := json.Unmarshal(raw, &status); err != nil {
+			return fmt.Errorf("parsing query-migrate reply: %w", err)
+		}
+
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("migration %s", status.Status)
+		}
+	}
+}
+
+// LoadState arranges for the machine to resume from a state file previously
+// written by SaveState. QEMU must be started (via Start) with -incoming
+// pointed at the file before the restored machine begins executing.
+func (m *Machine) LoadState(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("state file %q not found: %w", path, err)
+	}
+
+	m.incoming = fmt.Sprintf("exec:cat < %s", path)
+
+	return nil
+}
+
+// ListSnapshots returns the manifests of every snapshot taken for the given
+// machine.
+func ListSnapshots(machineID string) ([]SnapshotManifest, error) {
+	dir, err := snapshotDir(machineID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot directory: %w", err)
+	}
+
+	var manifests []SnapshotManifest
+
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".yaml" {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		var manifest SnapshotManifest
+		err = yaml.NewDecoder(f).Decode(&manifest)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %w", e.Name(), err)
+		}
+
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, nil
+}
+
+// PruneSnapshot removes a snapshot's overlay and manifest from disk.
+func PruneSnapshot(machineID, name string) error {
+	dir, err := snapshotDir(machineID)
+
+	if err != nil {
+		return err
+	}
+
+	err1 := os.Remove(filepath.Join(dir, name+".qcow2"))
+	err2 := os.Remove(filepath.Join(dir, name+".yaml"))
+
+	if err1 != nil {
+		return err1
+	}
+
+	return err2
+}
+
+// SnapshotCmd is the `fog snapshot` cobra command, exposing snapshot
+// list/prune from the CLI. It is exported so the root command (not part of
+// this package) can AddCommand it.
+var SnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage machine disk snapshots",
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list <machine-id>",
+	Short: "List snapshots for a machine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifests, err := ListSnapshots(args[0])
+
+		if err != nil {
+			return err
+		}
+
+		for _, m := range manifests {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", m.Name, m.Timestamp.Format(time.RFC3339))
+		}
+
+		return nil
+	},
+}
+
+var snapshotPruneCmd = &cobra.Command{
+	Use:   "prune <machine-id> <name>",
+	Short: "Delete a machine snapshot",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return PruneSnapshot(args[0], args[1])
+	},
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <machine-id> <name>",
+	Short: "Take a snapshot of a running machine",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// TODO: wire this up to a running-machine registry once one exists;
+		// for now Snapshot must be called directly against a *Machine.
+		return errors.New("snapshot create: no running machine registry to look up " + args[0] + " from the CLI yet")
+	},
+}
+
+func init() {
+	SnapshotCmd.AddCommand(snapshotListCmd, snapshotPruneCmd, snapshotCreateCmd)
+}